@@ -0,0 +1,223 @@
+package oauth2
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ghostec/Will.IAM/models"
+	"github.com/ghostec/Will.IAM/repositories"
+)
+
+const bitbucketAuthorizeEndpoint = "https://bitbucket.org/site/oauth2/authorize"
+const bitbucketTokenEndpoint = "https://bitbucket.org/site/oauth2/access_token"
+const bitbucketUserEndpoint = "https://api.bitbucket.org/2.0/user"
+const bitbucketEmailsEndpoint = "https://api.bitbucket.org/2.0/user/emails"
+
+const bitbucketProviderName = "bitbucket"
+
+// BitbucketConfig are the basic required informations to use Bitbucket
+// as oauth2 provider
+type BitbucketConfig struct {
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+}
+
+// Bitbucket implements Provider
+type Bitbucket struct {
+	config           BitbucketConfig
+	tokensRepository repositories.Tokens
+	client           *http.Client
+}
+
+// Name identifies this provider as "bitbucket"
+func (b *Bitbucket) Name() string {
+	return bitbucketProviderName
+}
+
+// BuildAuthURL returns an URL to authenticate with Bitbucket
+func (b *Bitbucket) BuildAuthURL(state string) string {
+	qs := mapToQueryStrings(map[string]string{
+		"state":         state,
+		"redirect_uri":  b.config.RedirectURL,
+		"client_id":     b.config.ClientID,
+		"response_type": "code",
+	})
+	return buildURL(bitbucketAuthorizeEndpoint, qs)
+}
+
+func (b *Bitbucket) buildExchangeCodeForm(code string) string {
+	v := url.Values{}
+	v.Add("code", code)
+	v.Add("grant_type", "authorization_code")
+	return v.Encode()
+}
+
+func (b *Bitbucket) basicAuthHeader() string {
+	raw := fmt.Sprintf("%s:%s", b.config.ClientID, b.config.ClientSecret)
+	return fmt.Sprintf("Basic %s", base64.StdEncoding.EncodeToString([]byte(raw)))
+}
+
+// ExchangeCode will trade code for full token with Bitbucket. Bitbucket
+// doesn't bind any request-specific data to state, so it's unused here.
+func (b *Bitbucket) ExchangeCode(code, state string) (*AuthResult, error) {
+	t, err := b.tokenFromCode(code)
+	if err != nil {
+		return nil, err
+	}
+	userInfo, err := b.getUserInfo(t.AccessToken)
+	if err != nil {
+		return nil, err
+	}
+	email, err := b.getPrimaryEmail(t.AccessToken)
+	if err != nil {
+		return nil, err
+	}
+	t.Email = email
+	if err := b.tokensRepository.Save(t); err != nil {
+		return nil, err
+	}
+	return &AuthResult{
+		Provider:    b.Name(),
+		AccessToken: t.AccessToken,
+		Email:       t.Email,
+		Name:        userInfo.DisplayName,
+		AvatarURL:   userInfo.Links.Avatar.Href,
+	}, nil
+}
+
+func (b *Bitbucket) tokenFromCode(code string) (*models.Token, error) {
+	ecf := b.buildExchangeCodeForm(code)
+	req, err := http.NewRequest(
+		"POST", bitbucketTokenEndpoint, strings.NewReader(ecf),
+	)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Add("Authorization", b.basicAuthHeader())
+	res, err := b.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	body, _ := ioutil.ReadAll(res.Body)
+	tmap := map[string]interface{}{}
+	if err := json.Unmarshal(body, &tmap); err != nil {
+		return nil, err
+	}
+	accessToken, ok := tmap["access_token"].(string)
+	if !ok {
+		return nil, fmt.Errorf("bitbucket: missing access_token in response")
+	}
+	return &models.Token{
+		AccessToken:  accessToken,
+		RefreshToken: fmt.Sprintf("%v", tmap["refresh_token"]),
+		TokenType:    fmt.Sprintf("%v", tmap["token_type"]),
+	}, nil
+}
+
+type bitbucketUserInfo struct {
+	DisplayName string `json:"display_name"`
+	Links       struct {
+		Avatar struct {
+			Href string `json:"href"`
+		} `json:"avatar"`
+	} `json:"links"`
+}
+
+func (b *Bitbucket) getUserInfo(accessToken string) (*bitbucketUserInfo, error) {
+	req, err := http.NewRequest("GET", bitbucketUserEndpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+	res, err := b.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	body, _ := ioutil.ReadAll(res.Body)
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf(
+			"bitbucket: user lookup failed with status %d: %s", res.StatusCode, body,
+		)
+	}
+	ui := &bitbucketUserInfo{}
+	if err := json.Unmarshal(body, ui); err != nil {
+		return nil, err
+	}
+	return ui, nil
+}
+
+type bitbucketEmail struct {
+	Values []struct {
+		Email     string `json:"email"`
+		IsPrimary bool   `json:"is_primary"`
+		Confirmed bool   `json:"is_confirmed"`
+	} `json:"values"`
+}
+
+func (b *Bitbucket) getPrimaryEmail(accessToken string) (string, error) {
+	req, err := http.NewRequest("GET", bitbucketEmailsEndpoint, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+	res, err := b.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	body, _ := ioutil.ReadAll(res.Body)
+	be := &bitbucketEmail{}
+	if err := json.Unmarshal(body, be); err != nil {
+		return "", err
+	}
+	for _, e := range be.Values {
+		if e.IsPrimary && e.Confirmed {
+			return e.Email, nil
+		}
+	}
+	return "", fmt.Errorf("bitbucket: no confirmed primary email found")
+}
+
+// Authenticate verifies if an accessToken is valid
+func (b *Bitbucket) Authenticate(accessToken string) (*AuthResult, error) {
+	t, err := b.tokensRepository.Get(accessToken)
+	if t == nil {
+		return nil, fmt.Errorf("access token not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	userInfo, err := b.getUserInfo(t.AccessToken)
+	if err != nil {
+		return nil, err
+	}
+	return &AuthResult{
+		Provider:    b.Name(),
+		AccessToken: t.AccessToken,
+		Email:       t.Email,
+		Name:        userInfo.DisplayName,
+		AvatarURL:   userInfo.Links.Avatar.Href,
+	}, nil
+}
+
+// NewBitbucket ctor
+func NewBitbucket(
+	config BitbucketConfig, tokensRepository repositories.Tokens,
+) *Bitbucket {
+	b := &Bitbucket{
+		config:           config,
+		tokensRepository: tokensRepository,
+		client:           &http.Client{},
+	}
+	Register(b)
+	return b
+}
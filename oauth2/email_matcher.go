@@ -0,0 +1,65 @@
+package oauth2
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ErrEmailNotAllowed is returned when a user's email fails the
+// configured hosted-domain, allow-list or deny-list checks, so the
+// HTTP layer can render a proper 403 instead of a generic error.
+type ErrEmailNotAllowed struct {
+	Email  string
+	Reason string
+}
+
+func (e ErrEmailNotAllowed) Error() string {
+	return fmt.Sprintf("email %q not allowed: %s", e.Email, e.Reason)
+}
+
+// emailMatchesAny reports whether email matches any of patterns. Each
+// pattern may be an exact address ("user@domain.com"), a wildcard
+// ("*@domain.com") or a regular expression delimited by slashes
+// ("/^.+@domain\.com$/").
+func emailMatchesAny(email string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if emailMatches(email, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+func emailMatches(email, pattern string) bool {
+	if strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") && len(pattern) > 1 {
+		re, err := regexp.Compile(pattern[1 : len(pattern)-1])
+		if err != nil {
+			return false
+		}
+		return re.MatchString(email)
+	}
+	if strings.HasPrefix(pattern, "*@") {
+		return strings.EqualFold(
+			email[strings.Index(email, "@")+1:], pattern[2:],
+		) && strings.Contains(email, "@")
+	}
+	return strings.EqualFold(email, pattern)
+}
+
+// checkEmailAllowed evaluates email against denied (checked first) and
+// allowed lists. An empty allowed list means "allow everything not
+// denied", matching checkHostedDomain's existing behavior for an empty
+// HostedDomains list.
+func checkEmailAllowed(email string, allowed, denied []string) error {
+	if emailMatchesAny(email, denied) {
+		return ErrEmailNotAllowed{Email: email, Reason: "explicitly denied"}
+	}
+	if len(allowed) == 0 {
+		return nil
+	}
+	if !emailMatchesAny(email, allowed) {
+		return ErrEmailNotAllowed{Email: email, Reason: "not in allow-list"}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package oauth2
+
+import "testing"
+
+func TestEmailMatchesExact(t *testing.T) {
+	if !emailMatches("user@domain.com", "user@domain.com") {
+		t.Error("expected exact match to match")
+	}
+	if emailMatches("other@domain.com", "user@domain.com") {
+		t.Error("expected exact match not to match a different address")
+	}
+}
+
+func TestEmailMatchesWildcard(t *testing.T) {
+	if !emailMatches("user@domain.com", "*@domain.com") {
+		t.Error("expected wildcard to match same domain")
+	}
+	if emailMatches("user@other.com", "*@domain.com") {
+		t.Error("expected wildcard not to match a different domain")
+	}
+}
+
+func TestEmailMatchesRegex(t *testing.T) {
+	if !emailMatches("user+ci@domain.com", `/^.+\+ci@domain\.com$/`) {
+		t.Error("expected regex to match")
+	}
+	if emailMatches("user@domain.com", `/^.+\+ci@domain\.com$/`) {
+		t.Error("expected regex not to match")
+	}
+}
+
+func TestCheckEmailAllowedDeniesFirst(t *testing.T) {
+	err := checkEmailAllowed(
+		"user@domain.com",
+		[]string{"*@domain.com"},
+		[]string{"user@domain.com"},
+	)
+	if _, ok := err.(ErrEmailNotAllowed); !ok {
+		t.Errorf("expected ErrEmailNotAllowed, got %v", err)
+	}
+}
+
+func TestCheckEmailAllowedEmptyAllowListAllowsAnythingNotDenied(t *testing.T) {
+	if err := checkEmailAllowed("user@domain.com", nil, nil); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
+
+func TestCheckEmailAllowedRejectsOutsideAllowList(t *testing.T) {
+	err := checkEmailAllowed(
+		"user@other.com", []string{"*@domain.com"}, nil,
+	)
+	if _, ok := err.(ErrEmailNotAllowed); !ok {
+		t.Errorf("expected ErrEmailNotAllowed, got %v", err)
+	}
+}
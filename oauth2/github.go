@@ -0,0 +1,212 @@
+package oauth2
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ghostec/Will.IAM/models"
+	"github.com/ghostec/Will.IAM/repositories"
+)
+
+const githubAuthorizeEndpoint = "https://github.com/login/oauth/authorize"
+const githubTokenEndpoint = "https://github.com/login/oauth/access_token"
+const githubUserEndpoint = "https://api.github.com/user"
+const githubEmailsEndpoint = "https://api.github.com/user/emails"
+
+const githubProviderName = "github"
+
+// GitHubConfig are the basic required informations to use GitHub
+// as oauth2 provider
+type GitHubConfig struct {
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+}
+
+// GitHub implements Provider
+type GitHub struct {
+	config           GitHubConfig
+	tokensRepository repositories.Tokens
+	client           *http.Client
+}
+
+// Name identifies this provider as "github"
+func (gh *GitHub) Name() string {
+	return githubProviderName
+}
+
+// BuildAuthURL returns an URL to authenticate with GitHub
+func (gh *GitHub) BuildAuthURL(state string) string {
+	qs := mapToQueryStrings(map[string]string{
+		"state":        state,
+		"redirect_uri": gh.config.RedirectURL,
+		"client_id":    gh.config.ClientID,
+		"scope":        url.QueryEscape("read:user user:email"),
+	})
+	return buildURL(githubAuthorizeEndpoint, qs)
+}
+
+func (gh *GitHub) buildExchangeCodeForm(code string) string {
+	v := url.Values{}
+	v.Add("code", code)
+	v.Add("client_id", gh.config.ClientID)
+	v.Add("client_secret", gh.config.ClientSecret)
+	v.Add("redirect_uri", gh.config.RedirectURL)
+	return v.Encode()
+}
+
+// ExchangeCode will trade code for full token with GitHub. GitHub
+// doesn't bind any request-specific data to state, so it's unused here.
+func (gh *GitHub) ExchangeCode(code, state string) (*AuthResult, error) {
+	t, err := gh.tokenFromCode(code)
+	if err != nil {
+		return nil, err
+	}
+	userInfo, err := gh.getUserInfo(t.AccessToken)
+	if err != nil {
+		return nil, err
+	}
+	email, err := gh.getPrimaryEmail(t.AccessToken)
+	if err != nil {
+		return nil, err
+	}
+	t.Email = email
+	if err := gh.tokensRepository.Save(t); err != nil {
+		return nil, err
+	}
+	return &AuthResult{
+		Provider:    gh.Name(),
+		AccessToken: t.AccessToken,
+		Email:       t.Email,
+		Name:        userInfo.Name,
+		AvatarURL:   userInfo.AvatarURL,
+	}, nil
+}
+
+func (gh *GitHub) tokenFromCode(code string) (*models.Token, error) {
+	ecf := gh.buildExchangeCodeForm(code)
+	req, err := http.NewRequest(
+		"POST", githubTokenEndpoint, strings.NewReader(ecf),
+	)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Add("Accept", "application/json")
+	res, err := gh.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	body, _ := ioutil.ReadAll(res.Body)
+	tmap := map[string]interface{}{}
+	if err := json.Unmarshal(body, &tmap); err != nil {
+		return nil, err
+	}
+	accessToken, ok := tmap["access_token"].(string)
+	if !ok {
+		return nil, fmt.Errorf("github: missing access_token in response")
+	}
+	return &models.Token{
+		AccessToken: accessToken,
+		TokenType:   fmt.Sprintf("%v", tmap["token_type"]),
+	}, nil
+}
+
+type githubUserInfo struct {
+	Name      string `json:"name"`
+	AvatarURL string `json:"avatar_url"`
+}
+
+func (gh *GitHub) getUserInfo(accessToken string) (*githubUserInfo, error) {
+	req, err := http.NewRequest("GET", githubUserEndpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Authorization", fmt.Sprintf("token %s", accessToken))
+	res, err := gh.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	body, _ := ioutil.ReadAll(res.Body)
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf(
+			"github: user lookup failed with status %d: %s", res.StatusCode, body,
+		)
+	}
+	ui := &githubUserInfo{}
+	if err := json.Unmarshal(body, ui); err != nil {
+		return nil, err
+	}
+	return ui, nil
+}
+
+type githubEmail struct {
+	Email    string `json:"email"`
+	Primary  bool   `json:"primary"`
+	Verified bool   `json:"verified"`
+}
+
+func (gh *GitHub) getPrimaryEmail(accessToken string) (string, error) {
+	req, err := http.NewRequest("GET", githubEmailsEndpoint, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Add("Authorization", fmt.Sprintf("token %s", accessToken))
+	res, err := gh.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	body, _ := ioutil.ReadAll(res.Body)
+	emails := []githubEmail{}
+	if err := json.Unmarshal(body, &emails); err != nil {
+		return "", err
+	}
+	for _, e := range emails {
+		if e.Primary && e.Verified {
+			return e.Email, nil
+		}
+	}
+	return "", fmt.Errorf("github: no verified primary email found")
+}
+
+// Authenticate verifies if an accessToken is valid
+func (gh *GitHub) Authenticate(accessToken string) (*AuthResult, error) {
+	t, err := gh.tokensRepository.Get(accessToken)
+	if t == nil {
+		return nil, fmt.Errorf("access token not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	userInfo, err := gh.getUserInfo(t.AccessToken)
+	if err != nil {
+		return nil, err
+	}
+	return &AuthResult{
+		Provider:    gh.Name(),
+		AccessToken: t.AccessToken,
+		Email:       t.Email,
+		Name:        userInfo.Name,
+		AvatarURL:   userInfo.AvatarURL,
+	}, nil
+}
+
+// NewGitHub ctor
+func NewGitHub(
+	config GitHubConfig, tokensRepository repositories.Tokens,
+) *GitHub {
+	gh := &GitHub{
+		config:           config,
+		tokensRepository: tokensRepository,
+		client:           &http.Client{},
+	}
+	Register(gh)
+	return gh
+}
@@ -1,12 +1,14 @@
 package oauth2
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/ghostec/Will.IAM/models"
@@ -16,6 +18,18 @@ import (
 const tokenEndpoint = "https://www.googleapis.com/oauth2/v4/token"
 const userEndpoint = "https://www.googleapis.com/oauth2/v2/userinfo"
 
+const googleProviderName = "google"
+
+// defaultRefreshSkew is used when GoogleConfig.RefreshSkew is left
+// unset.
+const defaultRefreshSkew = 5 * time.Minute
+
+// maxRefreshFailures is how many consecutive failed refresh attempts
+// RefreshLoop tolerates for a token before giving up and deleting it,
+// so a transient network blip against Google's token endpoint doesn't
+// log a user out on the first hiccup.
+const maxRefreshFailures = 3
+
 // GoogleConfig are the basic required informations to use Google
 // as oauth2 provider
 type GoogleConfig struct {
@@ -23,6 +37,29 @@ type GoogleConfig struct {
 	ClientSecret  string
 	RedirectURL   string
 	HostedDomains []string
+
+	// AllowedEmails and DeniedEmails further restrict which users may
+	// sign in, on top of HostedDomains. Each entry may be an exact
+	// address, a "*@domain.com" wildcard or a "/regex/". DeniedEmails
+	// is evaluated first, so it can carve out exceptions to a broader
+	// AllowedEmails pattern.
+	AllowedEmails []string
+	DeniedEmails  []string
+
+	// ServiceAccountJSON, ImpersonatedSubject and GroupRoleMap enable
+	// syncing Role bindings from Google Workspace group membership at
+	// login time. ServiceAccountJSON is the Google service account key
+	// used for domain-wide delegation, ImpersonatedSubject is the
+	// Workspace admin it impersonates to call the Admin SDK, and
+	// GroupRoleMap maps a group email to the Role names it grants.
+	ServiceAccountJSON  []byte
+	ImpersonatedSubject string
+	GroupRoleMap        map[string][]string
+
+	// RefreshSkew is how far ahead of its actual expiry a token is
+	// considered due for refresh, so it gets renewed before it's
+	// rejected. Defaults to defaultRefreshSkew when zero.
+	RefreshSkew time.Duration
 }
 
 var googleConfig GoogleConfig
@@ -41,9 +78,19 @@ func mapToQueryStrings(m map[string]string) string {
 
 // Google implements Provider
 type Google struct {
-	config           GoogleConfig
-	tokensRepository repositories.Tokens
-	client           *http.Client
+	config                    GoogleConfig
+	tokensRepository          repositories.Tokens
+	rolesRepository           repositories.Roles
+	serviceAccountsRepository repositories.ServiceAccounts
+	client                    *http.Client
+
+	refreshFailuresMu sync.Mutex
+	refreshFailures   map[string]int // access token -> consecutive failed refreshes
+}
+
+// Name identifies this provider as "google"
+func (g *Google) Name() string {
+	return googleProviderName
 }
 
 // BuildAuthURL returns an URL authenticate with Google
@@ -74,8 +121,9 @@ func (g *Google) buildExchangeCodeForm(code string) string {
 	return v.Encode()
 }
 
-// ExchangeCode will trade code for full token with Google
-func (g *Google) ExchangeCode(code string) (*AuthResult, error) {
+// ExchangeCode will trade code for full token with Google. Google
+// doesn't bind any request-specific data to state, so it's unused here.
+func (g *Google) ExchangeCode(code, state string) (*AuthResult, error) {
 	t, err := g.tokenFromCode(code)
 	if err != nil {
 		return nil, err
@@ -84,17 +132,28 @@ func (g *Google) ExchangeCode(code string) (*AuthResult, error) {
 	if err != nil {
 		return nil, err
 	}
-	allowed := g.checkHostedDomain(userInfo.HostedDomain)
-	if !allowed {
-		return nil, fmt.Errorf(
-			"email from non-allowed hosted domain %s", userInfo.HostedDomain,
-		)
+	if !g.checkHostedDomain(userInfo.HostedDomain) {
+		return nil, ErrEmailNotAllowed{
+			Email:  userInfo.Email,
+			Reason: fmt.Sprintf("hosted domain %q not allowed", userInfo.HostedDomain),
+		}
+	}
+	if err := checkEmailAllowed(
+		userInfo.Email, g.config.AllowedEmails, g.config.DeniedEmails,
+	); err != nil {
+		return nil, err
 	}
 	t.Email = userInfo.Email
 	if err := g.tokensRepository.Save(t); err != nil {
 		return nil, err
 	}
+	if len(g.config.GroupRoleMap) > 0 {
+		if err := g.syncGroupRoleBindings(t.Email); err != nil {
+			return nil, err
+		}
+	}
 	return &AuthResult{
+		Provider:    g.Name(),
 		AccessToken: t.AccessToken,
 		Email:       t.Email,
 	}, nil
@@ -144,6 +203,9 @@ func (g *Google) getUserInfo(accessToken string) (*userInfo, error) {
 		return nil, err
 	}
 	defer res.Body.Close()
+	if res.StatusCode == http.StatusUnauthorized {
+		return nil, errUnauthorized
+	}
 	body, _ := ioutil.ReadAll(res.Body)
 	ui := &userInfo{}
 	err = json.Unmarshal(body, ui)
@@ -153,6 +215,117 @@ func (g *Google) getUserInfo(accessToken string) (*userInfo, error) {
 	return ui, nil
 }
 
+var errUnauthorized = fmt.Errorf("access token rejected by google")
+
+func (g *Google) buildRefreshForm(refreshToken string) string {
+	v := url.Values{}
+	v.Add("client_id", g.config.ClientID)
+	v.Add("client_secret", g.config.ClientSecret)
+	v.Add("refresh_token", refreshToken)
+	v.Add("grant_type", "refresh_token")
+	return v.Encode()
+}
+
+// refresh exchanges t's RefreshToken for a new AccessToken/Expiry
+// (and RefreshToken, if Google rotates it), persists the result and
+// returns the refreshed token.
+func (g *Google) refresh(t *models.Token) (*models.Token, error) {
+	if t.RefreshToken == "" {
+		return nil, fmt.Errorf("token for %s has no refresh token", t.Email)
+	}
+	rf := g.buildRefreshForm(t.RefreshToken)
+	req, err := http.NewRequest("POST", tokenEndpoint, strings.NewReader(rf))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	res, err := g.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	body, _ := ioutil.ReadAll(res.Body)
+	tmap := map[string]interface{}{}
+	if err := json.Unmarshal(body, &tmap); err != nil {
+		return nil, err
+	}
+	accessToken, ok := tmap["access_token"].(string)
+	if !ok {
+		return nil, fmt.Errorf("google: missing access_token in refresh response")
+	}
+	t.AccessToken = accessToken
+	if rt, ok := tmap["refresh_token"].(string); ok && rt != "" {
+		t.RefreshToken = rt
+	}
+	if expiresIn, ok := tmap["expires_in"].(float64); ok {
+		t.Expiry = time.Now().Add(time.Second * time.Duration(expiresIn))
+	}
+	if err := g.tokensRepository.Save(t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// RefreshLoop proactively refreshes tokens nearing expiry every
+// interval, and deletes ones whose refresh keeps failing, similar to
+// oauth2_proxy's cookie-refresh behavior. It blocks until ctx is done.
+func (g *Google) RefreshLoop(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			g.refreshExpiring()
+		}
+	}
+}
+
+func (g *Google) refreshExpiring() {
+	expiring, err := g.tokensRepository.ListExpiringBefore(
+		time.Now().Add(g.refreshSkew()),
+	)
+	if err != nil {
+		return
+	}
+	for i := range expiring {
+		t := expiring[i]
+		accessToken := t.AccessToken
+		if _, err := g.refresh(&t); err != nil {
+			if g.recordRefreshFailure(accessToken) >= maxRefreshFailures {
+				_ = g.tokensRepository.Delete(accessToken)
+			}
+			continue
+		}
+		g.clearRefreshFailures(accessToken)
+	}
+}
+
+// recordRefreshFailure counts a failed refresh attempt for accessToken
+// and returns the new consecutive-failure count.
+func (g *Google) recordRefreshFailure(accessToken string) int {
+	g.refreshFailuresMu.Lock()
+	defer g.refreshFailuresMu.Unlock()
+	g.refreshFailures[accessToken]++
+	return g.refreshFailures[accessToken]
+}
+
+func (g *Google) clearRefreshFailures(accessToken string) {
+	g.refreshFailuresMu.Lock()
+	defer g.refreshFailuresMu.Unlock()
+	delete(g.refreshFailures, accessToken)
+}
+
+// refreshSkew returns the configured RefreshSkew, or defaultRefreshSkew
+// if the deployment didn't set one.
+func (g *Google) refreshSkew() time.Duration {
+	if g.config.RefreshSkew == 0 {
+		return defaultRefreshSkew
+	}
+	return g.config.RefreshSkew
+}
+
 func (g *Google) checkHostedDomain(hd string) bool {
 	if g.config.HostedDomains == nil || len(g.config.HostedDomains) == 0 {
 		return true
@@ -174,12 +347,21 @@ func (g *Google) Authenticate(accessToken string) (*AuthResult, error) {
 	if err != nil {
 		return nil, err
 	}
-	_, err = g.getUserInfo(t.AccessToken)
-	if err != nil {
+	if t.Expiry.Before(time.Now().Add(g.refreshSkew())) {
+		t, err = g.refresh(t)
+		if err != nil {
+			return nil, err
+		}
+	} else if _, err := g.getUserInfo(t.AccessToken); err == errUnauthorized {
+		t, err = g.refresh(t)
+		if err != nil {
+			return nil, err
+		}
+	} else if err != nil {
 		return nil, err
 	}
-	// TODO: handle refresh
 	return &AuthResult{
+		Provider:    g.Name(),
 		AccessToken: t.AccessToken,
 		Email:       t.Email,
 	}, nil
@@ -187,11 +369,19 @@ func (g *Google) Authenticate(accessToken string) (*AuthResult, error) {
 
 // NewGoogle ctor
 func NewGoogle(
-	config GoogleConfig, tokensRepository repositories.Tokens,
+	config GoogleConfig,
+	tokensRepository repositories.Tokens,
+	rolesRepository repositories.Roles,
+	serviceAccountsRepository repositories.ServiceAccounts,
 ) *Google {
-	return &Google{
-		config:           config,
-		tokensRepository: tokensRepository,
-		client:           &http.Client{},
+	g := &Google{
+		config:                    config,
+		tokensRepository:          tokensRepository,
+		rolesRepository:           rolesRepository,
+		serviceAccountsRepository: serviceAccountsRepository,
+		client:                    &http.Client{},
+		refreshFailures:           map[string]int{},
 	}
+	Register(g)
+	return g
 }
\ No newline at end of file
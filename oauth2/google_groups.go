@@ -0,0 +1,98 @@
+package oauth2
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"golang.org/x/oauth2/jwt"
+)
+
+const adminDirectoryGroupsScope = "https://www.googleapis.com/auth/admin.directory.group.readonly"
+const adminDirectoryGroupsEndpoint = "https://www.googleapis.com/admin/directory/v1/groups"
+
+type adminDirectoryGroup struct {
+	Email string `json:"email"`
+}
+
+type adminDirectoryGroupsResponse struct {
+	Groups []adminDirectoryGroup `json:"groups"`
+}
+
+// adminDirectoryClient returns an *http.Client authenticated as
+// ImpersonatedSubject via domain-wide delegation, able to call the
+// Admin SDK Directory API on the subject's behalf.
+func (g *Google) adminDirectoryClient() (*http.Client, error) {
+	cfg, err := jwt.GoogleJWTConfigFromJSON(
+		g.config.ServiceAccountJSON, adminDirectoryGroupsScope,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("google: invalid service account json: %v", err)
+	}
+	cfg.Subject = g.config.ImpersonatedSubject
+	return cfg.Client(nil), nil
+}
+
+// groupsForUser lists the Google Workspace groups email belongs to.
+func (g *Google) groupsForUser(email string) ([]string, error) {
+	client, err := g.adminDirectoryClient()
+	if err != nil {
+		return nil, err
+	}
+	url := fmt.Sprintf("%s?userKey=%s", adminDirectoryGroupsEndpoint, email)
+	res, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	body, _ := ioutil.ReadAll(res.Body)
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf(
+			"google: admin directory groups lookup for %s failed with status %d: %s",
+			email, res.StatusCode, body,
+		)
+	}
+	gr := &adminDirectoryGroupsResponse{}
+	if err := json.Unmarshal(body, gr); err != nil {
+		return nil, err
+	}
+	emails := make([]string, len(gr.Groups))
+	for i, group := range gr.Groups {
+		emails[i] = group.Email
+	}
+	return emails, nil
+}
+
+// desiredRoleNames resolves the Role names implied by GroupRoleMap for
+// the groups a user belongs to, deduplicated.
+func (g *Google) desiredRoleNames(groupEmails []string) []string {
+	seen := map[string]bool{}
+	names := []string{}
+	for _, groupEmail := range groupEmails {
+		for _, name := range g.config.GroupRoleMap[groupEmail] {
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// syncGroupRoleBindings binds/unbinds email's service account so its
+// Role bindings match what GroupRoleMap implies from its current
+// Google Workspace group membership.
+func (g *Google) syncGroupRoleBindings(email string) error {
+	sa, err := g.serviceAccountsRepository.GetByEmail(email)
+	if err != nil {
+		return err
+	}
+	groupEmails, err := g.groupsForUser(email)
+	if err != nil {
+		return err
+	}
+	desired := g.desiredRoleNames(groupEmails)
+	return g.rolesRepository.SyncBindingsForServiceAccount(sa.ID, desired)
+}
@@ -0,0 +1,252 @@
+package oauth2
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ghostec/Will.IAM/models"
+	"github.com/ghostec/Will.IAM/repositories"
+)
+
+const jwtBearerProviderName = "jwtbearer"
+
+// jwtBearerClockSkew bounds how far nbf/exp may disagree with server
+// time, to tolerate minor clock drift between caller and server.
+const jwtBearerClockSkew = 30 * time.Second
+
+// JWTBearerConfig are the basic required informations to use the
+// jwtbearer provider
+type JWTBearerConfig struct {
+	// Audience is the expected `aud` claim, identifying this Will.IAM
+	// deployment as the intended recipient of the assertion.
+	Audience string
+}
+
+// JWTBearer implements Provider for service-account authentication via
+// signed JWT bearer assertions (RFC 7523): a client signs a JWT with a
+// private key whose public counterpart was pre-registered for its
+// models.ServiceAccount, and trades it for a Will.IAM access token at
+// /sso/auth/jwt without any human interaction.
+type JWTBearer struct {
+	config                       JWTBearerConfig
+	serviceAccountKeysRepository repositories.ServiceAccountKeys
+	tokensRepository             repositories.Tokens
+
+	seenJTIsMu sync.Mutex
+	seenJTIs   map[string]time.Time // jti -> expiry, for replay detection
+}
+
+// Name identifies this provider as "jwtbearer"
+func (j *JWTBearer) Name() string {
+	return jwtBearerProviderName
+}
+
+// BuildAuthURL doesn't apply to the bearer assertion flow, which has
+// no redirect step; it always returns an empty string.
+func (j *JWTBearer) BuildAuthURL(state string) string {
+	return ""
+}
+
+// ExchangeCode doesn't apply to the bearer assertion flow; callers
+// should use Exchange with a signed JWT assertion instead.
+func (j *JWTBearer) ExchangeCode(code, state string) (*AuthResult, error) {
+	return nil, fmt.Errorf("jwtbearer: authorization code flow not supported, use Exchange")
+}
+
+// Exchange verifies a client-signed JWT bearer assertion against the
+// public key registered for its `sub` service account and, if valid,
+// mints and persists a new Will.IAM access token for it.
+func (j *JWTBearer) Exchange(assertion string) (*AuthResult, error) {
+	claims, err := j.verifyAssertion(assertion)
+	if err != nil {
+		return nil, err
+	}
+	sub, _ := claims["sub"].(string)
+	t := &models.Token{
+		AccessToken: randomString(32),
+		Email:       sub,
+		Expiry:      time.Now().Add(time.Hour),
+	}
+	if err := j.tokensRepository.Save(t); err != nil {
+		return nil, err
+	}
+	return &AuthResult{
+		Provider:    j.Name(),
+		AccessToken: t.AccessToken,
+		Email:       t.Email,
+	}, nil
+}
+
+func (j *JWTBearer) verifyAssertion(assertion string) (map[string]interface{}, error) {
+	parts := strings.Split(assertion, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("jwtbearer: malformed assertion")
+	}
+	header := map[string]interface{}{}
+	if err := unmarshalSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	claims := map[string]interface{}{}
+	if err := unmarshalSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	sub, _ := claims["sub"].(string)
+	if sub == "" {
+		return nil, fmt.Errorf("jwtbearer: missing sub claim")
+	}
+	alg, _ := header["alg"].(string)
+	pub, err := j.publicKeyFor(sub, alg)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(alg, pub, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, err
+	}
+	if err := j.validateClaims(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (j *JWTBearer) publicKeyFor(serviceAccountID, algorithm string) (interface{}, error) {
+	keys, err := j.serviceAccountKeysRepository.ForServiceAccountID(serviceAccountID)
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range keys {
+		if k.Algorithm != algorithm {
+			continue
+		}
+		block, _ := pem.Decode([]byte(k.PublicKeyPEM))
+		if block == nil {
+			continue
+		}
+		pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			continue
+		}
+		return pub, nil
+	}
+	return nil, fmt.Errorf(
+		"jwtbearer: no registered %s key for service account %q", algorithm, serviceAccountID,
+	)
+}
+
+func verifySignature(alg string, pub interface{}, signed string, sig []byte) error {
+	digest := sha256.Sum256([]byte(signed))
+	switch alg {
+	case "RS256":
+		rsaPub, ok := pub.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("jwtbearer: registered key is not RSA")
+		}
+		return rsa.VerifyPKCS1v15(rsaPub, crypto.SHA256, digest[:], sig)
+	case "ES256":
+		ecPub, ok := pub.(*ecdsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("jwtbearer: registered key is not ECDSA")
+		}
+		if len(sig) != 64 {
+			return fmt.Errorf("jwtbearer: malformed ES256 signature")
+		}
+		r := new(big.Int).SetBytes(sig[:32])
+		s := new(big.Int).SetBytes(sig[32:])
+		if !ecdsa.Verify(ecPub, digest[:], r, s) {
+			return fmt.Errorf("jwtbearer: signature verification failed")
+		}
+		return nil
+	default:
+		return fmt.Errorf("jwtbearer: unsupported algorithm %q", alg)
+	}
+}
+
+func (j *JWTBearer) validateClaims(claims map[string]interface{}) error {
+	now := time.Now()
+	if aud, _ := claims["aud"].(string); aud != j.config.Audience {
+		return fmt.Errorf("jwtbearer: unexpected audience %q", aud)
+	}
+	if iss, _ := claims["iss"].(string); iss == "" {
+		return fmt.Errorf("jwtbearer: missing iss claim")
+	}
+	exp, ok := claims["exp"].(float64)
+	expiresAt := time.Unix(int64(exp), 0).Add(jwtBearerClockSkew)
+	if !ok || expiresAt.Before(now) {
+		return fmt.Errorf("jwtbearer: assertion expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && time.Unix(int64(nbf), 0).After(now.Add(jwtBearerClockSkew)) {
+		return fmt.Errorf("jwtbearer: assertion not yet valid")
+	}
+	jti, _ := claims["jti"].(string)
+	if jti == "" {
+		return fmt.Errorf("jwtbearer: missing jti claim")
+	}
+	return j.checkAndRememberJTI(jti, expiresAt)
+}
+
+// checkAndRememberJTI rejects an assertion whose jti was already seen,
+// preventing replay of a captured assertion within its validity window.
+func (j *JWTBearer) checkAndRememberJTI(jti string, expiresAt time.Time) error {
+	j.seenJTIsMu.Lock()
+	defer j.seenJTIsMu.Unlock()
+	now := time.Now()
+	for seen, expiry := range j.seenJTIs {
+		if expiry.Before(now) {
+			delete(j.seenJTIs, seen)
+		}
+	}
+	if _, ok := j.seenJTIs[jti]; ok {
+		return fmt.Errorf("jwtbearer: assertion jti %q already used", jti)
+	}
+	j.seenJTIs[jti] = expiresAt
+	return nil
+}
+
+// Authenticate verifies if a Will.IAM access token minted by Exchange
+// is still valid.
+func (j *JWTBearer) Authenticate(accessToken string) (*AuthResult, error) {
+	t, err := j.tokensRepository.Get(accessToken)
+	if t == nil {
+		return nil, fmt.Errorf("access token not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if t.Expiry.Before(time.Now()) {
+		return nil, fmt.Errorf("access token expired")
+	}
+	return &AuthResult{
+		Provider:    j.Name(),
+		AccessToken: t.AccessToken,
+		Email:       t.Email,
+	}, nil
+}
+
+// NewJWTBearer ctor
+func NewJWTBearer(
+	config JWTBearerConfig,
+	serviceAccountKeysRepository repositories.ServiceAccountKeys,
+	tokensRepository repositories.Tokens,
+) *JWTBearer {
+	j := &JWTBearer{
+		config:                       config,
+		serviceAccountKeysRepository: serviceAccountKeysRepository,
+		tokensRepository:             tokensRepository,
+		seenJTIs:                     map[string]time.Time{},
+	}
+	Register(j)
+	return j
+}
@@ -0,0 +1,349 @@
+package oauth2
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ghostec/Will.IAM/models"
+	"github.com/ghostec/Will.IAM/repositories"
+)
+
+const oidcProviderName = "oidc"
+const oidcWellKnownPath = "/.well-known/openid-configuration"
+
+// OIDCConfig are the basic required informations to use a generic
+// OIDC-compliant identity provider
+type OIDCConfig struct {
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type jwks struct {
+	Keys []jwk `json:"keys"`
+}
+
+// OIDC implements Provider against any OIDC-compliant issuer, using
+// discovery to locate its endpoints and JWKS to verify ID tokens.
+type OIDC struct {
+	config           OIDCConfig
+	tokensRepository repositories.Tokens
+	client           *http.Client
+	discovery        oidcDiscovery
+	jwks             jwks
+
+	noncesMu sync.Mutex
+	nonces   map[string]string // state -> nonce
+}
+
+// Name identifies this provider as "oidc"
+func (o *OIDC) Name() string {
+	return oidcProviderName
+}
+
+// BuildAuthURL returns an URL to authenticate with the configured
+// OIDC issuer, binding a fresh nonce to state so ExchangeCode can
+// later validate the returned ID token wasn't replayed.
+func (o *OIDC) BuildAuthURL(state string) string {
+	nonce := randomString(16)
+	o.noncesMu.Lock()
+	o.nonces[state] = nonce
+	o.noncesMu.Unlock()
+
+	scopes := o.config.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"openid", "profile", "email"}
+	}
+	qs := mapToQueryStrings(map[string]string{
+		"state":         state,
+		"nonce":         nonce,
+		"redirect_uri":  o.config.RedirectURL,
+		"client_id":     o.config.ClientID,
+		"scope":         strings.Join(scopes, "+"),
+		"response_type": "code",
+	})
+	return buildURL(o.discovery.AuthorizationEndpoint, qs)
+}
+
+// ExchangeCode trades code for a token, verifies the returned ID
+// token's signature and claims against the issuer's JWKS and checks
+// its nonce against the one bound to state in BuildAuthURL, so a
+// captured authorization code can't be replayed against a different
+// login attempt.
+func (o *OIDC) ExchangeCode(code, state string) (*AuthResult, error) {
+	t, idToken, err := o.tokenFromCode(code)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := o.verifyIDToken(idToken)
+	if err != nil {
+		return nil, err
+	}
+	o.noncesMu.Lock()
+	expectedNonce, ok := o.nonces[state]
+	delete(o.nonces, state)
+	o.noncesMu.Unlock()
+	if !ok || claims["nonce"] != expectedNonce {
+		return nil, fmt.Errorf("oidc: nonce mismatch for state %q", state)
+	}
+	email, _ := claims["email"].(string)
+	name, _ := claims["name"].(string)
+	picture, _ := claims["picture"].(string)
+	t.Email = email
+	if err := o.tokensRepository.Save(t); err != nil {
+		return nil, err
+	}
+	return &AuthResult{
+		Provider:    o.Name(),
+		AccessToken: t.AccessToken,
+		Email:       t.Email,
+		Name:        name,
+		AvatarURL:   picture,
+	}, nil
+}
+
+func (o *OIDC) buildExchangeCodeForm(code string) string {
+	v := make(map[string]string)
+	v["code"] = code
+	v["client_id"] = o.config.ClientID
+	v["client_secret"] = o.config.ClientSecret
+	v["redirect_uri"] = o.config.RedirectURL
+	v["grant_type"] = "authorization_code"
+	return mapToQueryStrings(v)
+}
+
+func (o *OIDC) tokenFromCode(code string) (*models.Token, string, error) {
+	ecf := o.buildExchangeCodeForm(code)
+	req, err := http.NewRequest(
+		"POST", o.discovery.TokenEndpoint, strings.NewReader(ecf),
+	)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	res, err := o.client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer res.Body.Close()
+	body, _ := ioutil.ReadAll(res.Body)
+	tmap := map[string]interface{}{}
+	if err := json.Unmarshal(body, &tmap); err != nil {
+		return nil, "", err
+	}
+	accessToken, ok := tmap["access_token"].(string)
+	if !ok {
+		return nil, "", fmt.Errorf("oidc: missing access_token in response")
+	}
+	idToken, ok := tmap["id_token"].(string)
+	if !ok {
+		return nil, "", fmt.Errorf("oidc: missing id_token in response")
+	}
+	expiry := time.Now()
+	if expiresIn, ok := tmap["expires_in"].(float64); ok {
+		expiry = expiry.Add(time.Second * time.Duration(expiresIn))
+	}
+	return &models.Token{
+		AccessToken:  accessToken,
+		RefreshToken: fmt.Sprintf("%v", tmap["refresh_token"]),
+		TokenType:    fmt.Sprintf("%v", tmap["token_type"]),
+		Expiry:       expiry,
+	}, idToken, nil
+}
+
+// verifyIDToken checks the ID token's RS256 signature against the
+// issuer's JWKS and validates the iss/aud/exp claims.
+func (o *OIDC) verifyIDToken(idToken string) (map[string]interface{}, error) {
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("oidc: malformed id_token")
+	}
+	header := map[string]interface{}{}
+	if err := unmarshalSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	kid, _ := header["kid"].(string)
+	key, err := o.findKey(kid)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, err
+	}
+	signed := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, signed[:], sig); err != nil {
+		return nil, fmt.Errorf("oidc: id_token signature verification failed: %v", err)
+	}
+	claims := map[string]interface{}{}
+	if err := unmarshalSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+	if iss, _ := claims["iss"].(string); iss != o.discovery.Issuer {
+		return nil, fmt.Errorf("oidc: unexpected issuer %q", iss)
+	}
+	if aud, _ := claims["aud"].(string); aud != o.config.ClientID {
+		return nil, fmt.Errorf("oidc: unexpected audience %q", aud)
+	}
+	if exp, ok := claims["exp"].(float64); ok {
+		if time.Unix(int64(exp), 0).Before(time.Now()) {
+			return nil, fmt.Errorf("oidc: id_token expired")
+		}
+	}
+	return claims, nil
+}
+
+func (o *OIDC) findKey(kid string) (*rsa.PublicKey, error) {
+	for _, k := range o.jwks.Keys {
+		if k.Kid != kid || k.Kty != "RSA" {
+			continue
+		}
+		nBytes, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		eBytes, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		e := 0
+		for _, b := range eBytes {
+			e = e<<8 | int(b)
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(nBytes), E: e}, nil
+	}
+	return nil, fmt.Errorf("oidc: no matching key for kid %q", kid)
+}
+
+func unmarshalSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func randomString(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Authenticate verifies if an accessToken is still valid by re-fetching
+// the issuer's userinfo endpoint with it.
+func (o *OIDC) Authenticate(accessToken string) (*AuthResult, error) {
+	t, err := o.tokensRepository.Get(accessToken)
+	if t == nil {
+		return nil, fmt.Errorf("access token not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("GET", o.discovery.UserinfoEndpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Add("Authorization", fmt.Sprintf("Bearer %s", t.AccessToken))
+	res, err := o.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusUnauthorized {
+		return nil, errUnauthorized
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf(
+			"oidc: userinfo lookup failed with status %d", res.StatusCode,
+		)
+	}
+	return &AuthResult{
+		Provider:    o.Name(),
+		AccessToken: t.AccessToken,
+		Email:       t.Email,
+	}, nil
+}
+
+func discoverOIDC(client *http.Client, issuerURL string) (oidcDiscovery, error) {
+	res, err := client.Get(strings.TrimRight(issuerURL, "/") + oidcWellKnownPath)
+	if err != nil {
+		return oidcDiscovery{}, err
+	}
+	defer res.Body.Close()
+	body, _ := ioutil.ReadAll(res.Body)
+	d := oidcDiscovery{}
+	if err := json.Unmarshal(body, &d); err != nil {
+		return oidcDiscovery{}, err
+	}
+	return d, nil
+}
+
+func fetchJWKS(client *http.Client, jwksURI string) (jwks, error) {
+	res, err := client.Get(jwksURI)
+	if err != nil {
+		return jwks{}, err
+	}
+	defer res.Body.Close()
+	body, _ := ioutil.ReadAll(res.Body)
+	j := jwks{}
+	if err := json.Unmarshal(body, &j); err != nil {
+		return jwks{}, err
+	}
+	return j, nil
+}
+
+// NewOIDC ctor. Unlike the other providers, it performs discovery of
+// the issuer's `.well-known/openid-configuration` and fetches its JWKS
+// up front, so it can fail if the issuer is unreachable or misconfigured.
+func NewOIDC(
+	config OIDCConfig, tokensRepository repositories.Tokens,
+) (*OIDC, error) {
+	client := &http.Client{}
+	discovery, err := discoverOIDC(client, config.IssuerURL)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: discovery failed: %v", err)
+	}
+	keys, err := fetchJWKS(client, discovery.JWKSURI)
+	if err != nil {
+		return nil, fmt.Errorf("oidc: fetching jwks failed: %v", err)
+	}
+	o := &OIDC{
+		config:           config,
+		tokensRepository: tokensRepository,
+		client:           client,
+		discovery:        discovery,
+		jwks:             keys,
+		nonces:           map[string]string{},
+	}
+	Register(o)
+	return o, nil
+}
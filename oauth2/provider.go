@@ -0,0 +1,53 @@
+package oauth2
+
+import "fmt"
+
+// AuthResult carries the normalized outcome of a successful
+// authentication, regardless of which Provider produced it, so that
+// downstream role-binding logic can work uniformly across providers.
+type AuthResult struct {
+	Provider    string
+	AccessToken string
+	Email       string
+	Name        string
+	AvatarURL   string
+}
+
+// Provider abstracts an OAuth2/OIDC identity provider. Implementations
+// live alongside this file (Google, GitHub, OIDC, Bitbucket, JWTBearer) and are
+// picked at request time via the provider= query param or per-route
+// configuration.
+type Provider interface {
+	// Name identifies the provider, e.g. "google", "github", "oidc" or
+	// "bitbucket". It's also used to tag AuthResult.Provider.
+	Name() string
+	// BuildAuthURL returns the URL the user should be redirected to in
+	// order to authenticate with this provider.
+	BuildAuthURL(state string) string
+	// ExchangeCode trades an authorization code for a token and the
+	// authenticated user's profile. state is whatever was passed to
+	// BuildAuthURL for this login attempt; providers that bind
+	// request-specific data to it (e.g. OIDC's nonce) validate it here.
+	ExchangeCode(code, state string) (*AuthResult, error)
+	// Authenticate verifies an previously issued access token, maybe
+	// refreshing it along the way.
+	Authenticate(accessToken string) (*AuthResult, error)
+}
+
+var providers = map[string]Provider{}
+
+// Register makes p resolvable by name through ForProvider. Provider
+// constructors call this so the auth handler can route requests based
+// on the provider= query param without knowing concrete types.
+func Register(p Provider) {
+	providers[p.Name()] = p
+}
+
+// ForProvider returns the Provider registered under name.
+func ForProvider(name string) (Provider, error) {
+	p, ok := providers[name]
+	if !ok {
+		return nil, fmt.Errorf("oauth2: no provider registered for %q", name)
+	}
+	return p, nil
+}
@@ -9,6 +9,12 @@ type Roles interface {
 	ForServiceAccountID(string) ([]models.Role, error)
 	Create(*models.Role) error
 	Bind(models.Role, models.ServiceAccount) error
+	Unbind(models.Role, models.ServiceAccount) error
+	ByName(string) (*models.Role, error)
+	// SyncBindingsForServiceAccount reconciles saID's role bindings so
+	// it ends up bound to exactly desiredRoleNames, binding the ones
+	// it's missing and unbinding the ones it shouldn't have anymore.
+	SyncBindingsForServiceAccount(saID string, desiredRoleNames []string) error
 }
 
 type roles struct {
@@ -49,6 +55,64 @@ func (rs roles) Bind(r models.Role, sa models.ServiceAccount) error {
 	return err
 }
 
+func (rs roles) Unbind(r models.Role, sa models.ServiceAccount) error {
+	_, err := rs.storage.PG.DB.Exec(
+		`DELETE FROM role_bindings
+		WHERE role_id = ? AND service_account_id = ?`,
+		r.ID, sa.ID,
+	)
+	return err
+}
+
+func (rs roles) ByName(name string) (*models.Role, error) {
+	r := &models.Role{}
+	_, err := rs.storage.PG.DB.Query(
+		r, "SELECT id, name FROM roles WHERE name = ?", name,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// SyncBindingsForServiceAccount reconciles saID's role bindings against
+// desiredRoleNames, used to keep bindings in lockstep with an external
+// source of truth (e.g. Google Workspace group membership).
+func (rs roles) SyncBindingsForServiceAccount(
+	saID string, desiredRoleNames []string,
+) error {
+	current, err := rs.ForServiceAccountID(saID)
+	if err != nil {
+		return err
+	}
+	desired := map[string]bool{}
+	for _, name := range desiredRoleNames {
+		desired[name] = true
+	}
+	currentByName := map[string]models.Role{}
+	for _, r := range current {
+		currentByName[r.Name] = r
+		if !desired[r.Name] {
+			if err := rs.Unbind(r, models.ServiceAccount{ID: saID}); err != nil {
+				return err
+			}
+		}
+	}
+	for name := range desired {
+		if _, ok := currentByName[name]; ok {
+			continue
+		}
+		r, err := rs.ByName(name)
+		if err != nil {
+			return err
+		}
+		if err := rs.Bind(*r, models.ServiceAccount{ID: saID}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // NewRoles roles ctor
 func NewRoles(s *Storage) Roles {
 	return &roles{storage: s}
@@ -0,0 +1,69 @@
+package repositories
+
+import (
+	"github.com/ghostec/Will.IAM/models"
+)
+
+// ServiceAccountKeys repository manages the public keys service
+// accounts register to authenticate via signed JWT bearer assertions.
+type ServiceAccountKeys interface {
+	Create(*models.ServiceAccountKey) error
+	ForServiceAccountID(serviceAccountID string) ([]models.ServiceAccountKey, error)
+	Get(id string) (*models.ServiceAccountKey, error)
+	Revoke(id string) error
+}
+
+type serviceAccountKeys struct {
+	storage *Storage
+}
+
+func (sak serviceAccountKeys) Create(k *models.ServiceAccountKey) error {
+	_, err := sak.storage.PG.DB.Query(
+		k, `INSERT INTO service_account_keys
+		(service_account_id, public_key_pem, algorithm)
+		VALUES (?service_account_id, ?public_key_pem, ?algorithm)
+		RETURNING id, created_at`, k,
+	)
+	return err
+}
+
+func (sak serviceAccountKeys) ForServiceAccountID(
+	serviceAccountID string,
+) ([]models.ServiceAccountKey, error) {
+	var keys []models.ServiceAccountKey
+	_, err := sak.storage.PG.DB.Query(
+		&keys,
+		`SELECT id, service_account_id, public_key_pem, algorithm,
+		created_at, revoked_at FROM service_account_keys
+		WHERE service_account_id = ? AND revoked_at IS NULL`,
+		serviceAccountID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (sak serviceAccountKeys) Get(id string) (*models.ServiceAccountKey, error) {
+	k := &models.ServiceAccountKey{}
+	_, err := sak.storage.PG.DB.Query(
+		k, `SELECT id, service_account_id, public_key_pem, algorithm,
+		created_at, revoked_at FROM service_account_keys WHERE id = ?`, id,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+func (sak serviceAccountKeys) Revoke(id string) error {
+	_, err := sak.storage.PG.DB.Exec(
+		`UPDATE service_account_keys SET revoked_at = now() WHERE id = ?`, id,
+	)
+	return err
+}
+
+// NewServiceAccountKeys serviceAccountKeys ctor
+func NewServiceAccountKeys(s *Storage) ServiceAccountKeys {
+	return &serviceAccountKeys{storage: s}
+}
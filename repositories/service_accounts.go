@@ -0,0 +1,30 @@
+package repositories
+
+import (
+	"github.com/ghostec/Will.IAM/models"
+)
+
+// ServiceAccounts repository
+type ServiceAccounts interface {
+	GetByEmail(email string) (*models.ServiceAccount, error)
+}
+
+type serviceAccounts struct {
+	storage *Storage
+}
+
+func (sas serviceAccounts) GetByEmail(email string) (*models.ServiceAccount, error) {
+	sa := &models.ServiceAccount{}
+	_, err := sas.storage.PG.DB.Query(
+		sa, "SELECT id, email FROM service_accounts WHERE email = ?", email,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return sa, nil
+}
+
+// NewServiceAccounts serviceAccounts ctor
+func NewServiceAccounts(s *Storage) ServiceAccounts {
+	return &serviceAccounts{storage: s}
+}
@@ -0,0 +1,72 @@
+package repositories
+
+import (
+	"time"
+
+	"github.com/ghostec/Will.IAM/models"
+)
+
+// Tokens repository
+type Tokens interface {
+	Get(accessToken string) (*models.Token, error)
+	Save(t *models.Token) error
+	ListExpiringBefore(time.Time) ([]models.Token, error)
+	Delete(accessToken string) error
+}
+
+type tokens struct {
+	storage *Storage
+}
+
+func (ts tokens) Get(accessToken string) (*models.Token, error) {
+	t := &models.Token{}
+	_, err := ts.storage.PG.DB.Query(
+		t, `SELECT access_token, refresh_token, token_type, email, expiry
+		FROM tokens WHERE access_token = ?`, accessToken,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (ts tokens) Save(t *models.Token) error {
+	_, err := ts.storage.PG.DB.Query(
+		t, `INSERT INTO tokens (access_token, refresh_token, token_type, email, expiry)
+		VALUES (?access_token, ?refresh_token, ?token_type, ?email, ?expiry)
+		ON CONFLICT (access_token) DO UPDATE SET
+			refresh_token = EXCLUDED.refresh_token,
+			token_type = EXCLUDED.token_type,
+			email = EXCLUDED.email,
+			expiry = EXCLUDED.expiry`, t,
+	)
+	return err
+}
+
+// ListExpiringBefore returns every token whose Expiry is before t, so
+// the background refresher can proactively renew them.
+func (ts tokens) ListExpiringBefore(t time.Time) ([]models.Token, error) {
+	var ts2 []models.Token
+	_, err := ts.storage.PG.DB.Query(
+		&ts2, `SELECT access_token, refresh_token, token_type, email, expiry
+		FROM tokens WHERE expiry < ?`, t,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return ts2, nil
+}
+
+// Delete removes a token, used when its refresh has failed repeatedly
+// and it can no longer be renewed.
+func (ts tokens) Delete(accessToken string) error {
+	_, err := ts.storage.PG.DB.Exec(
+		`DELETE FROM tokens WHERE access_token = ?`, accessToken,
+	)
+	return err
+}
+
+// NewTokens tokens ctor
+func NewTokens(s *Storage) Tokens {
+	return &tokens{storage: s}
+}